@@ -0,0 +1,134 @@
+package pool
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer selects the next target to dial from a list of candidates.
+type Balancer interface {
+	Next(targets []string) string
+}
+
+// RandomBalancer picks a uniformly random target; this is the pool's original behavior.
+type RandomBalancer struct{}
+
+// NewRandomBalancer returns a new RandomBalancer.
+func NewRandomBalancer() *RandomBalancer { return &RandomBalancer{} }
+
+func (b *RandomBalancer) Next(targets []string) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	return targets[rand.Int()%len(targets)]
+}
+
+// RoundRobinBalancer cycles through targets in order.
+type RoundRobinBalancer struct {
+	idx uint64
+}
+
+// NewRoundRobinBalancer returns a new RoundRobinBalancer.
+func NewRoundRobinBalancer() *RoundRobinBalancer { return &RoundRobinBalancer{} }
+
+func (b *RoundRobinBalancer) Next(targets []string) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	i := atomic.AddUint64(&b.idx, 1) - 1
+	return targets[i%uint64(len(targets))]
+}
+
+// WeightedRandomBalancer picks a random target weighted by an optional
+// "host:port|weight" suffix; targets without a weight suffix default to 1.
+type WeightedRandomBalancer struct{}
+
+// NewWeightedRandomBalancer returns a new WeightedRandomBalancer.
+func NewWeightedRandomBalancer() *WeightedRandomBalancer { return &WeightedRandomBalancer{} }
+
+func (b *WeightedRandomBalancer) Next(targets []string) string {
+	if len(targets) == 0 {
+		return ""
+	}
+
+	addrs := make([]string, len(targets))
+	weights := make([]int, len(targets))
+	total := 0
+	for i, t := range targets {
+		addr, weight := parseWeightedTarget(t)
+		addrs[i] = addr
+		weights[i] = weight
+		total += weight
+	}
+	if total <= 0 {
+		return addrs[rand.Int()%len(addrs)]
+	}
+
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return addrs[i]
+		}
+		n -= w
+	}
+	return addrs[len(addrs)-1]
+}
+
+// parseWeightedTarget splits a "host:port|weight" target into its address and
+// weight; targets with no (or an invalid) weight suffix default to weight 1.
+func parseWeightedTarget(target string) (addr string, weight int) {
+	addr, weight = target, 1
+	idx := strings.LastIndex(target, "|")
+	if idx < 0 {
+		return addr, weight
+	}
+	if w, err := strconv.Atoi(target[idx+1:]); err == nil && w > 0 {
+		addr, weight = target[:idx], w
+	}
+	return addr, weight
+}
+
+// LeastConnBalancer picks the target with the fewest in-flight streams, as
+// reported by the GRPCPool it is attached to.
+type LeastConnBalancer struct {
+	mu      sync.RWMutex
+	counter func(target string) int
+}
+
+// NewLeastConnBalancer returns a new LeastConnBalancer. It has no effect until
+// a GRPCPool is created with it set as Options.Balancer, which wires it to the
+// pool's per-target in-flight counts.
+func NewLeastConnBalancer() *LeastConnBalancer { return &LeastConnBalancer{} }
+
+// setCounter wires the balancer to its owning pool's in-flight stream counts.
+// Called by NewGRPCPool; not meant to be called directly by users.
+func (b *LeastConnBalancer) setCounter(counter func(target string) int) {
+	b.mu.Lock()
+	b.counter = counter
+	b.mu.Unlock()
+}
+
+func (b *LeastConnBalancer) Next(targets []string) string {
+	if len(targets) == 0 {
+		return ""
+	}
+
+	b.mu.RLock()
+	counter := b.counter
+	b.mu.RUnlock()
+	if counter == nil {
+		//not yet attached to a pool, fall back to random
+		return targets[rand.Int()%len(targets)]
+	}
+
+	best, min := targets[0], -1
+	for _, t := range targets {
+		if n := counter(t); min == -1 || n < min {
+			best, min = t, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,102 @@
+package pool
+
+import "testing"
+
+func TestRandomBalancer(t *testing.T) {
+	b := NewRandomBalancer()
+	targets := []string{"a", "b", "c"}
+
+	for i := 0; i < 50; i++ {
+		got := b.Next(targets)
+		if got != "a" && got != "b" && got != "c" {
+			t.Fatalf("Next() = %q, not in targets", got)
+		}
+	}
+
+	if got := b.Next(nil); got != "" {
+		t.Fatalf("Next(nil) = %q, want empty", got)
+	}
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	b := NewRoundRobinBalancer()
+	targets := []string{"a", "b", "c"}
+
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i, w := range want {
+		if got := b.Next(targets); got != w {
+			t.Fatalf("call %d: Next() = %q, want %q", i, got, w)
+		}
+	}
+
+	if got := b.Next(nil); got != "" {
+		t.Fatalf("Next(nil) = %q, want empty", got)
+	}
+}
+
+func TestWeightedRandomBalancer(t *testing.T) {
+	b := NewWeightedRandomBalancer()
+	targets := []string{"a|1", "b|99"}
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		counts[b.Next(targets)]++
+	}
+
+	if counts["b"] <= counts["a"] {
+		t.Fatalf("expected b (weight 99) to be picked far more often than a (weight 1), got %v", counts)
+	}
+	if counts["a|1"] != 0 || counts["b|99"] != 0 {
+		t.Fatalf("Next() must return the address with the weight suffix stripped, got %v", counts)
+	}
+}
+
+func TestWeightedRandomBalancerNoWeights(t *testing.T) {
+	b := NewWeightedRandomBalancer()
+	targets := []string{"a", "b"}
+
+	got := b.Next(targets)
+	if got != "a" && got != "b" {
+		t.Fatalf("Next() = %q, want one of %v", got, targets)
+	}
+}
+
+func TestParseWeightedTarget(t *testing.T) {
+	cases := []struct {
+		target     string
+		wantAddr   string
+		wantWeight int
+	}{
+		{"127.0.0.1:9000", "127.0.0.1:9000", 1},
+		{"127.0.0.1:9000|5", "127.0.0.1:9000", 5},
+		{"127.0.0.1:9000|bogus", "127.0.0.1:9000|bogus", 1},
+	}
+
+	for _, c := range cases {
+		addr, weight := parseWeightedTarget(c.target)
+		if addr != c.wantAddr || weight != c.wantWeight {
+			t.Errorf("parseWeightedTarget(%q) = (%q, %d), want (%q, %d)", c.target, addr, weight, c.wantAddr, c.wantWeight)
+		}
+	}
+}
+
+func TestLeastConnBalancer(t *testing.T) {
+	b := NewLeastConnBalancer()
+	counts := map[string]int{"a": 5, "b": 1, "c": 3}
+	b.setCounter(func(target string) int { return counts[target] })
+
+	got := b.Next([]string{"a", "b", "c"})
+	if got != "b" {
+		t.Fatalf("Next() = %q, want %q (fewest in-flight)", got, "b")
+	}
+}
+
+func TestLeastConnBalancerNoCounter(t *testing.T) {
+	b := NewLeastConnBalancer()
+	targets := []string{"a", "b"}
+
+	got := b.Next(targets)
+	if got != "a" && got != "b" {
+		t.Fatalf("Next() without a counter = %q, want one of %v", got, targets)
+	}
+}
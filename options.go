@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"sync"
@@ -8,10 +9,11 @@ import (
 )
 
 var (
-	errClosed   = errors.New("pool is closed")
-	errInvalid  = errors.New("invalid config")
-	errRejected = errors.New("connection is nil. rejecting")
-	errTargets  = errors.New("targets server is empty")
+	errClosed        = errors.New("pool is closed")
+	errInvalid       = errors.New("invalid config")
+	errRejected      = errors.New("connection is nil. rejecting")
+	errTargets       = errors.New("targets server is empty")
+	errPoolExhausted = errors.New("pool: max capacity reached")
 )
 
 type TimeoutType int
@@ -25,19 +27,31 @@ func init() {
 	rand.NewSource(time.Now().UnixNano())
 }
 
-//Options pool options
+// Options pool options
 type Options struct {
-	lock         sync.RWMutex
-	targets      *[]string      //targets node
-	input        chan *[]string //targets channel
-	InitTargets  []string       //InitTargets init targets
-	InitCap      int            // init connection
-	MaxCap       int            // max connections
-	TimeoutType  TimeoutType    //timeout type, fixed or idle
-	DialTimeout  time.Duration  //dial timeout
-	IdleTimeout  time.Duration  //timeout in program
-	ReadTimeout  time.Duration  //unused
-	WriteTimeout time.Duration  //unused
+	lock                sync.RWMutex
+	targets             *[]string                                    //targets node
+	input               chan *[]string                               //targets channel
+	Context             context.Context                              //parent context; cancellation tears down the pool and update()
+	Balancer            Balancer                                     //load balancing policy; defaults to RandomBalancer
+	MetricsHook         func(event string, labels map[string]string) //optional hook for dial/evict events, e.g. wired to Prometheus
+	InitTargets         []string                                     //InitTargets init targets
+	InitCap             int                                          // init connection
+	MaxCap              int                                          // max connections
+	MaxStreams          int                                          // max concurrent streams multiplexed on a single conn
+	MaxIdle             int                                          // max idle (warm) conns kept per target, <= MaxCap; with N targets total idle can reach MaxIdle*N
+	MinIdle             int                                          // min idle (warm) conns the health checker refills per target, <= MaxCap
+	TimeoutType         TimeoutType                                  //timeout type, fixed or idle
+	DialTimeout         time.Duration                                //dial timeout
+	CallTimeout         time.Duration                                //per-RPC timeout, used by GRPCPool.GetContext; 0 disables
+	IdleTimeout         time.Duration                                //timeout in program
+	HealthCheckInterval time.Duration                                //background conn health-check period; 0 disables
+	ReadTimeout         time.Duration                                //unused
+	WriteTimeout        time.Duration                                //unused
+	LazyInit            bool                                         // if true, NewGRPCPool returns immediately and warms InitCap conns in the background
+	WarmupConcurrency   int                                          // parallel dials while warming up under LazyInit; <=0 treated as 1
+	DialRetries         int                                          // retries per warmup dial before giving up on that conn
+	DialBackoff         time.Duration                                // base backoff between warmup dial retries, doubled each attempt
 }
 
 // Input is the input channel
@@ -50,15 +64,28 @@ func (o *Options) update() {
 	//init targets
 	o.targets = &o.InitTargets
 
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	go func() {
-		for targets := range o.input {
-			if targets == nil {
-				continue
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case targets, ok := <-o.input:
+				if !ok {
+					return
+				}
+				if targets == nil {
+					continue
+				}
+
+				o.lock.Lock()
+				o.targets = targets
+				o.lock.Unlock()
 			}
-
-			o.lock.Lock()
-			o.targets = targets
-			o.lock.Unlock()
 		}
 	}()
 
@@ -69,11 +96,19 @@ func NewOptions() *Options {
 	o := &Options{}
 	o.InitCap = 5
 	o.MaxCap = 100
+	o.MaxStreams = 64
+	o.MaxIdle = o.InitCap
+	o.MinIdle = 0
+	o.Balancer = NewRandomBalancer()
 	o.TimeoutType = IdleTimeoutType
 	o.DialTimeout = 5 * time.Second
 	o.ReadTimeout = 5 * time.Second
 	o.WriteTimeout = 5 * time.Second
 	o.IdleTimeout = 60 * time.Second
+	o.LazyInit = true
+	o.WarmupConcurrency = 2
+	o.DialRetries = 3
+	o.DialBackoff = 200 * time.Millisecond
 	return o
 }
 
@@ -83,6 +118,15 @@ func (o *Options) validate() error {
 		o.InitCap <= 0 ||
 		o.MaxCap <= 0 ||
 		o.InitCap > o.MaxCap ||
+		o.MaxStreams <= 0 ||
+		o.MaxIdle < 0 ||
+		o.MaxIdle > o.MaxCap ||
+		o.MinIdle < 0 ||
+		o.MinIdle > o.MaxCap ||
+		o.CallTimeout < 0 ||
+		o.HealthCheckInterval < 0 ||
+		o.DialRetries < 0 ||
+		o.DialBackoff < 0 ||
 		!(o.TimeoutType == IdleTimeoutType || o.TimeoutType == FixedTimeoutType) ||
 		o.DialTimeout == 0 ||
 		o.ReadTimeout == 0 ||
@@ -92,16 +136,19 @@ func (o *Options) validate() error {
 	return nil
 }
 
-//nextTarget next target implement load balance
+// nextTarget next target implement load balance
 func (o *Options) nextTarget() string {
 	o.lock.RLock()
-	defer o.lock.RUnlock()
+	targets := *o.targets
+	o.lock.RUnlock()
 
-	tlen := len(*o.targets)
-	if tlen <= 0 {
+	if len(targets) == 0 {
 		return ""
 	}
 
-	//rand server
-	return (*o.targets)[rand.Int()%tlen]
+	b := o.Balancer
+	if b == nil {
+		b = NewRandomBalancer()
+	}
+	return b.Next(targets)
 }
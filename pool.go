@@ -0,0 +1,26 @@
+package pool
+
+import "context"
+
+// Pool is a generic connection pool interface, so this package can host
+// additional transports (HTTP/2, Thrift, raw TCP) without duplicating the
+// idle/busy-list and timeout machinery GRPCPool already implements.
+type Pool interface {
+	Acquire(ctx context.Context) (Conn, error)
+	Release(conn Conn, err error)
+	Stats() Stats
+	Close()
+}
+
+// Conn is an opaque pooled resource handed out by Acquire and returned via Release.
+type Conn interface{}
+
+// Stats reports point-in-time pool counters.
+type Stats struct {
+	Idle       int   // conns currently idle (below MaxStreams capacity)
+	InUse      int   // conns currently at or near MaxStreams capacity
+	Dials      int64 // successful dials since pool creation
+	DialErrors int64 // failed dials since pool creation
+	Timeouts   int64 // dials made by Get/Acquire that failed due to a deadline; warm-up and refill dials are not counted
+	Evictions  int64 // conns closed and discarded (idle timeout, health check, Release error, or MaxIdle overflow on Put)
+}
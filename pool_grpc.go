@@ -1,83 +1,522 @@
 package pool
 
 import (
+	"container/list"
 	"context"
+	"errors"
+	"io"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
-//GRPCPool pool info
+// healthCheckWaitTimeout bounds how long the reaper waits for a Connecting/Idle
+// conn to settle into a stable state before moving on.
+const healthCheckWaitTimeout = 200 * time.Millisecond
+
+// GRPCPool pool info
 type GRPCPool struct {
-	Mu          sync.Mutex
-	IdleTimeout time.Duration
-	timeoutType TimeoutType
-	conns       chan *GrpcIdleConn
-	factory     func() (*grpc.ClientConn, error)
-	close       func(*grpc.ClientConn) error
+	Mu              sync.Mutex
+	IdleTimeout     time.Duration
+	timeoutType     TimeoutType
+	subPools        map[string]*targetSubPool // idle/busy lists keyed by dial target
+	total           int                       // idle + busy conn count, across all targets
+	maxCap          int
+	maxIdle         int
+	minIdle         int
+	maxStreams      int32
+	callTimeout     time.Duration
+	healthCheckStop chan struct{}
+	nextTarget      func() string
+	factory         func(ctx context.Context, target string) (*grpc.ClientConn, error)
+	close           func(*grpc.ClientConn) error
+	metricsHook     func(event string, labels map[string]string)
+
+	dials      int64 // atomic
+	dialErrors int64 // atomic
+	timeouts   int64 // atomic
+	evictions  int64 // atomic
+}
+
+var _ Pool = (*GRPCPool)(nil)
+
+// emit reports event to the configured MetricsHook, if any.
+func (c *GRPCPool) emit(event, target string) {
+	if c.metricsHook != nil {
+		c.metricsHook(event, map[string]string{"target": target})
+	}
+}
+
+// targetSubPool holds the idle/busy conns dialed against a single target.
+type targetSubPool struct {
+	idle *list.List // idle conns, streams < maxStreams
+	busy *list.List // conns at or near MaxStreams capacity
 }
 
 type GrpcIdleConn struct {
-	Conn *grpc.ClientConn
-	t    time.Time
+	Conn       *grpc.ClientConn
+	target     string
+	t          time.Time
+	streams    int32 // current in-use stream count, atomic
+	maxStreams int32
+	elem       *list.Element
+	inBusy     bool
 }
 
-//Get get from pool
+// Get get from pool
 func (c *GRPCPool) Get() (*GrpcIdleConn, error) {
+	conn, err := c.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*GrpcIdleConn), nil
+}
+
+// Acquire implements Pool.
+func (c *GRPCPool) Acquire(ctx context.Context) (Conn, error) {
+	wrapConn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return wrapConn, nil
+}
+
+// Release implements Pool. A non-nil err that looks like a dead conn
+// (codes.Unavailable, io.EOF) closes and discards conn instead of returning
+// it to the idle list.
+func (c *GRPCPool) Release(conn Conn, err error) {
+	wrapConn, ok := conn.(*GrpcIdleConn)
+	if !ok || wrapConn == nil {
+		return
+	}
+
+	if isDeadConnErr(err) {
+		c.discard(wrapConn)
+		return
+	}
+
+	c.Put(wrapConn)
+}
+
+// discard force-closes wrapConn and removes it from whichever list (idle or
+// busy) currently holds it.
+func (c *GRPCPool) discard(wrapConn *GrpcIdleConn) {
+	c.Mu.Lock()
+	sp, ok := c.subPools[wrapConn.target]
+	if ok && wrapConn.elem != nil {
+		if wrapConn.inBusy {
+			sp.busy.Remove(wrapConn.elem)
+		} else {
+			sp.idle.Remove(wrapConn.elem)
+		}
+		c.total--
+	}
+	c.Mu.Unlock()
+
+	atomic.AddInt64(&c.evictions, 1)
+	c.emit("evict", wrapConn.target)
+	c.close(wrapConn.Conn)
+}
+
+func isDeadConnErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// Stats implements Pool.
+func (c *GRPCPool) Stats() Stats {
 	c.Mu.Lock()
-	conns := c.conns
+	var idle, inUse int
+	for _, sp := range c.subPools {
+		idle += sp.idle.Len()
+		inUse += sp.busy.Len()
+	}
 	c.Mu.Unlock()
 
-	if conns == nil {
+	return Stats{
+		Idle:       idle,
+		InUse:      inUse,
+		Dials:      atomic.LoadInt64(&c.dials),
+		DialErrors: atomic.LoadInt64(&c.dialErrors),
+		Timeouts:   atomic.LoadInt64(&c.timeouts),
+		Evictions:  atomic.LoadInt64(&c.evictions),
+	}
+}
+
+// GetContext gets a conn and returns a context derived from ctx and bounded by
+// Options.CallTimeout (if set); callers should use the returned context for the
+// RPC itself, and must call cancel once the RPC is done.
+func (c *GRPCPool) GetContext(ctx context.Context) (*GrpcIdleConn, context.Context, context.CancelFunc, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cancel := func() {}
+	if c.callTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.callTimeout)
+	}
+
+	conn, err := c.getConn(ctx)
+	return conn, ctx, cancel, err
+}
+
+func (c *GRPCPool) getConn(ctx context.Context) (*GrpcIdleConn, error) {
+	target := c.nextTarget()
+	if target == "" {
+		return nil, errTargets
+	}
+
+	c.Mu.Lock()
+
+	if c.subPools == nil {
+		c.Mu.Unlock()
 		return nil, errClosed
 	}
-	for {
-		select {
-		case wrapConn := <-conns:
-			if wrapConn == nil || wrapConn.Conn == nil {
-				return nil, errClosed
-			}
-			//判断是否超时，超时则丢弃
-			if timeout := c.IdleTimeout; timeout > 0 {
-				if wrapConn.t.Add(timeout).Before(time.Now()) {
-					//丢弃并关闭该链接
-					c.close(wrapConn.Conn)
-					continue
-				}
+
+	sp := c.subPoolFor(target)
+
+	for e := sp.idle.Front(); e != nil; {
+		wrapConn := e.Value.(*GrpcIdleConn)
+		next := e.Next()
+
+		//判断是否超时，超时则丢弃
+		if timeout := c.IdleTimeout; timeout > 0 && wrapConn.t.Add(timeout).Before(time.Now()) {
+			sp.idle.Remove(e)
+			c.total--
+			c.Mu.Unlock()
+			atomic.AddInt64(&c.evictions, 1)
+			c.emit("evict", target)
+			c.close(wrapConn.Conn)
+			c.Mu.Lock()
+			e = next
+			continue
+		}
+
+		//连接已经不可用，丢弃并换下一个
+		if state := wrapConn.Conn.GetState(); state == connectivity.Shutdown || state == connectivity.TransientFailure {
+			sp.idle.Remove(e)
+			c.total--
+			c.Mu.Unlock()
+			atomic.AddInt64(&c.evictions, 1)
+			c.emit("evict", target)
+			c.close(wrapConn.Conn)
+			c.Mu.Lock()
+			e = next
+			continue
+		}
+
+		//复用未打满的连接
+		if atomic.LoadInt32(&wrapConn.streams) < wrapConn.maxStreams {
+			if atomic.AddInt32(&wrapConn.streams, 1) >= wrapConn.maxStreams {
+				sp.idle.Remove(e)
+				wrapConn.inBusy = true
+				wrapConn.elem = sp.busy.PushBack(wrapConn)
 			}
+			c.Mu.Unlock()
 			return wrapConn, nil
-		default:
-			conn, err := c.factory()
-			if err != nil {
-				return nil, err
-			}
-			return c.createGrpcIdleConn(conn), nil
 		}
+
+		e = next
+	}
+
+	//该 target 空闲列表里没有可复用的连接，按 MaxCap 上限新建
+	if c.total >= c.maxCap {
+		c.Mu.Unlock()
+		return nil, errPoolExhausted
+	}
+	c.total++
+	c.Mu.Unlock()
+
+	conn, err := c.factory(ctx, target)
+	if err != nil {
+		c.Mu.Lock()
+		c.total--
+		c.Mu.Unlock()
+		atomic.AddInt64(&c.dialErrors, 1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			atomic.AddInt64(&c.timeouts, 1)
+		}
+		c.emit("dial_error", target)
+		return nil, err
+	}
+	atomic.AddInt64(&c.dials, 1)
+	c.emit("dial", target)
+
+	wrapConn := c.createGrpcIdleConn(conn, target)
+	atomic.AddInt32(&wrapConn.streams, 1)
+
+	c.Mu.Lock()
+	if c.subPools == nil {
+		c.Mu.Unlock()
+		c.close(conn)
+		return nil, errClosed
+	}
+	sp = c.subPoolFor(target)
+	if wrapConn.streams >= wrapConn.maxStreams {
+		wrapConn.inBusy = true
+		wrapConn.elem = sp.busy.PushBack(wrapConn)
+	} else {
+		wrapConn.elem = sp.idle.PushBack(wrapConn)
+	}
+	c.Mu.Unlock()
+
+	return wrapConn, nil
+}
+
+// subPoolFor returns the sub-pool for target, creating it if needed. Callers
+// must hold c.Mu.
+func (c *GRPCPool) subPoolFor(target string) *targetSubPool {
+	sp, ok := c.subPools[target]
+	if !ok {
+		sp = &targetSubPool{idle: list.New(), busy: list.New()}
+		c.subPools[target] = sp
+	}
+	return sp
+}
+
+// targetInFlight reports the total in-use stream count for target, for use by
+// LeastConnBalancer.
+func (c *GRPCPool) targetInFlight(target string) int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	sp, ok := c.subPools[target]
+	if !ok {
+		return 0
+	}
+
+	inFlight := 0
+	for e := sp.idle.Front(); e != nil; e = e.Next() {
+		inFlight += int(atomic.LoadInt32(&e.Value.(*GrpcIdleConn).streams))
+	}
+	for e := sp.busy.Front(); e != nil; e = e.Next() {
+		inFlight += int(atomic.LoadInt32(&e.Value.(*GrpcIdleConn).streams))
+	}
+	return inFlight
+}
+
+// runHealthCheck periodically drains idle conns, evicting dead ones and
+// refilling each target's sub-pool back up to MinIdle.
+func (c *GRPCPool) runHealthCheck(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.reapOnce()
+		}
+	}
+}
+
+func (c *GRPCPool) reapOnce() {
+	c.Mu.Lock()
+	if c.subPools == nil {
+		c.Mu.Unlock()
+		return
+	}
+	targets := make([]string, 0, len(c.subPools))
+	for target := range c.subPools {
+		targets = append(targets, target)
+	}
+	c.Mu.Unlock()
+
+	for _, target := range targets {
+		c.reapTarget(target)
+	}
+}
+
+func (c *GRPCPool) reapTarget(target string) {
+	c.Mu.Lock()
+	if c.subPools == nil {
+		c.Mu.Unlock()
+		return
+	}
+	sp, ok := c.subPools[target]
+	if !ok {
+		c.Mu.Unlock()
+		return
+	}
+	idle := make([]*GrpcIdleConn, 0, sp.idle.Len())
+	for e := sp.idle.Front(); e != nil; e = e.Next() {
+		idle = append(idle, e.Value.(*GrpcIdleConn))
+	}
+	c.Mu.Unlock()
+
+	for _, wrapConn := range idle {
+		switch state := wrapConn.Conn.GetState(); state {
+		case connectivity.Shutdown, connectivity.TransientFailure:
+			c.evictIdle(target, wrapConn)
+		case connectivity.Connecting, connectivity.Idle:
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckWaitTimeout)
+			wrapConn.Conn.WaitForStateChange(ctx, state)
+			cancel()
+		}
+	}
+
+	c.refillIdle(target)
+}
+
+// evictIdle closes and removes wrapConn from target's idle list, if still present.
+func (c *GRPCPool) evictIdle(target string, wrapConn *GrpcIdleConn) {
+	c.Mu.Lock()
+	sp, ok := c.subPools[target]
+	if !ok || wrapConn.inBusy || wrapConn.elem == nil {
+		c.Mu.Unlock()
+		return
+	}
+	sp.idle.Remove(wrapConn.elem)
+	c.total--
+	c.Mu.Unlock()
+
+	atomic.AddInt64(&c.evictions, 1)
+	c.emit("evict", target)
+	c.close(wrapConn.Conn)
+}
+
+// refillIdle dials fresh conns for target until its idle list reaches MinIdle
+// or the pool hits MaxCap.
+func (c *GRPCPool) refillIdle(target string) {
+	for {
+		c.Mu.Lock()
+		if c.subPools == nil {
+			c.Mu.Unlock()
+			return
+		}
+		sp := c.subPoolFor(target)
+		if sp.idle.Len() >= c.minIdle || c.total >= c.maxCap {
+			c.Mu.Unlock()
+			return
+		}
+		c.total++
+		c.Mu.Unlock()
+
+		conn, err := c.factory(context.Background(), target)
+		if err != nil {
+			c.Mu.Lock()
+			c.total--
+			c.Mu.Unlock()
+			atomic.AddInt64(&c.dialErrors, 1)
+			c.emit("dial_error", target)
+			return
+		}
+		atomic.AddInt64(&c.dials, 1)
+		c.emit("dial", target)
+
+		wrapConn := c.createGrpcIdleConn(conn, target)
+		c.Mu.Lock()
+		if c.subPools == nil {
+			c.Mu.Unlock()
+			c.close(conn)
+			return
+		}
+		sp = c.subPoolFor(target)
+		wrapConn.elem = sp.idle.PushBack(wrapConn)
+		c.Mu.Unlock()
+	}
+}
+
+// warmUp dials InitCap conns in the background for a LazyInit pool, retrying
+// transient failures with exponential backoff so a registry/DNS flap at
+// startup doesn't leave the pool permanently short of warm conns.
+func (c *GRPCPool) warmUp(o *Options) {
+	concurrency := o.WarmupConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < o.InitCap; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.warmOne(o)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *GRPCPool) warmOne(o *Options) {
+	target := o.nextTarget()
+	if target == "" {
+		return
+	}
+
+	var conn *grpc.ClientConn
+	var err error
+	backoff := o.DialBackoff
+	for attempt := 0; attempt <= o.DialRetries; attempt++ {
+		conn, err = c.factory(context.Background(), target)
+		if err == nil {
+			break
+		}
+		atomic.AddInt64(&c.dialErrors, 1)
+		c.emit("dial_error", target)
+		if attempt == o.DialRetries {
+			return
+		}
+		if backoff > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	atomic.AddInt64(&c.dials, 1)
+	c.emit("dial", target)
+
+	c.Mu.Lock()
+	if c.subPools == nil || c.total >= c.maxCap {
+		c.Mu.Unlock()
+		c.close(conn)
+		return
 	}
+	c.total++
+	sp := c.subPoolFor(target)
+	wrapConn := c.createGrpcIdleConn(conn, target)
+	wrapConn.elem = sp.idle.PushBack(wrapConn)
+	c.Mu.Unlock()
 }
-func (c *GRPCPool) createGrpcIdleConn(conn *grpc.ClientConn) *GrpcIdleConn {
+
+func (c *GRPCPool) createGrpcIdleConn(conn *grpc.ClientConn, target string) *GrpcIdleConn {
 	t := time.Now()
 	switch c.timeoutType {
 	case IdleTimeoutType:
 	case FixedTimeoutType: //create time advances random life cycle, avoid massive unusable Conn, alive: 1~1.5
 		t = t.Add(-time.Millisecond * time.Duration(rand.Int63n(c.IdleTimeout.Milliseconds()/2)))
 	}
-	return &GrpcIdleConn{Conn: conn, t: t}
+	return &GrpcIdleConn{Conn: conn, target: target, t: t, maxStreams: c.maxStreams}
 }
 
-//Put put back to pool
+// Put put back to pool
 func (c *GRPCPool) Put(conn *GrpcIdleConn) error {
 	if conn == nil || conn.Conn == nil {
 		return errRejected
 	}
 
 	c.Mu.Lock()
-	defer c.Mu.Unlock()
 
-	if c.conns == nil {
-		return c.close(conn.Conn)
+	if c.subPools == nil {
+		c.Mu.Unlock()
+		//pool already closed this conn (and every other one it held) in
+		//Close(); the caller can't act on a double-close error, so swallow it
+		c.close(conn.Conn)
+		return nil
 	}
 
 	switch c.timeoutType {
@@ -86,44 +525,80 @@ func (c *GRPCPool) Put(conn *GrpcIdleConn) error {
 	case FixedTimeoutType:
 	}
 
-	select {
-	case c.conns <- conn:
+	if streams := atomic.AddInt32(&conn.streams, -1); streams < 0 {
+		atomic.StoreInt32(&conn.streams, 0)
+	}
+
+	//连接不再打满，归还给其 target 的空闲列表，但不超过 MaxIdle
+	sp, ok := c.subPools[conn.target]
+	if !ok || !conn.inBusy || atomic.LoadInt32(&conn.streams) >= conn.maxStreams {
+		c.Mu.Unlock()
 		return nil
-	default:
-		//连接池已满，直接关闭该链接
+	}
+
+	sp.busy.Remove(conn.elem)
+	conn.inBusy = false
+	conn.elem = nil
+
+	if c.maxIdle > 0 && sp.idle.Len() >= c.maxIdle {
+		c.total--
+		c.Mu.Unlock()
+		atomic.AddInt64(&c.evictions, 1)
+		c.emit("evict", conn.target)
 		return c.close(conn.Conn)
 	}
+
+	conn.elem = sp.idle.PushBack(conn)
+	c.Mu.Unlock()
+	return nil
 }
 
-//Close close pool
+// Close close pool. factory and close are set once at construction and never
+// cleared here: background goroutines (warmUp, the health-check reaper) only
+// ever observe c.subPools == nil to know the pool is closed, and may still be
+// mid-dial when Close returns, so they must keep calling valid funcs.
 func (c *GRPCPool) Close() {
 	c.Mu.Lock()
-	conns := c.conns
-	c.conns = nil
-	c.factory = nil
-	closeFun := c.close
-	c.close = nil
+	subPools := c.subPools
+	c.subPools = nil
+	c.total = 0
+	healthCheckStop := c.healthCheckStop
+	c.healthCheckStop = nil
 	c.Mu.Unlock()
 
-	if conns == nil {
+	if healthCheckStop != nil {
+		close(healthCheckStop)
+	}
+
+	if subPools == nil {
 		return
 	}
 
-	close(conns)
-	for wrapConn := range conns {
-		closeFun(wrapConn.Conn)
+	for _, sp := range subPools {
+		for e := sp.idle.Front(); e != nil; e = e.Next() {
+			c.close(e.Value.(*GrpcIdleConn).Conn)
+		}
+		for e := sp.busy.Front(); e != nil; e = e.Next() {
+			c.close(e.Value.(*GrpcIdleConn).Conn)
+		}
 	}
 }
 
-//IdleCount idle connection count
+// IdleCount idle connection count, across all targets
 func (c *GRPCPool) IdleCount() int {
 	c.Mu.Lock()
-	conns := c.conns
-	c.Mu.Unlock()
-	return len(conns)
+	defer c.Mu.Unlock()
+	if c.subPools == nil {
+		return 0
+	}
+	n := 0
+	for _, sp := range c.subPools {
+		n += sp.idle.Len()
+	}
+	return n
 }
 
-//NewGRPCPool init grpc pool
+// NewGRPCPool init grpc pool
 func NewGRPCPool(o *Options, dialOptions ...grpc.DialOption) (*GRPCPool, error) {
 	if err := o.validate(); err != nil {
 		return nil, err
@@ -131,34 +606,71 @@ func NewGRPCPool(o *Options, dialOptions ...grpc.DialOption) (*GRPCPool, error)
 
 	//init pool
 	pool := &GRPCPool{
-		conns: make(chan *GrpcIdleConn, o.MaxCap),
-		factory: func() (*grpc.ClientConn, error) {
-			target := o.nextTarget()
-			if target == "" {
-				return nil, errTargets
-			}
-
-			ctx, cancel := context.WithTimeout(context.Background(), o.DialTimeout)
+		subPools:   make(map[string]*targetSubPool),
+		nextTarget: o.nextTarget,
+		factory: func(ctx context.Context, target string) (*grpc.ClientConn, error) {
+			dialCtx, cancel := context.WithTimeout(ctx, o.DialTimeout)
 			defer cancel()
 
-			return grpc.DialContext(ctx, target, dialOptions...)
+			return grpc.DialContext(dialCtx, target, dialOptions...)
 		},
 		close:       func(v *grpc.ClientConn) error { return v.Close() },
 		timeoutType: o.TimeoutType,
 		IdleTimeout: o.IdleTimeout,
+		maxCap:      o.MaxCap,
+		maxIdle:     o.MaxIdle,
+		minIdle:     o.MinIdle,
+		maxStreams:  int32(o.MaxStreams),
+		callTimeout: o.CallTimeout,
+		metricsHook: o.MetricsHook,
+	}
+
+	//least-conn balancing needs to read the pool's own in-flight counts
+	if lcb, ok := o.Balancer.(*LeastConnBalancer); ok {
+		lcb.setCounter(pool.targetInFlight)
 	}
 
 	//danamic update targets
 	o.update()
 
-	//init make conns
-	for i := 0; i < o.InitCap; i++ {
-		conn, err := pool.factory()
-		if err != nil {
-			pool.Close()
-			return nil, err
+	if o.LazyInit {
+		//return immediately; Get() dials on demand and warmUp fills InitCap in the background
+		go pool.warmUp(o)
+	} else {
+		//eager init, same as before LazyInit existed: any dial failure tears the whole pool down
+		for i := 0; i < o.InitCap; i++ {
+			target := o.nextTarget()
+			if target == "" {
+				pool.Close()
+				return nil, errTargets
+			}
+
+			conn, err := pool.factory(context.Background(), target)
+			if err != nil {
+				pool.Close()
+				return nil, err
+			}
+			atomic.AddInt64(&pool.dials, 1)
+			pool.emit("dial", target)
+			pool.total++
+			sp := pool.subPoolFor(target)
+			wrapConn := pool.createGrpcIdleConn(conn, target)
+			wrapConn.elem = sp.idle.PushBack(wrapConn)
 		}
-		pool.conns <- pool.createGrpcIdleConn(conn)
+	}
+
+	//background reaper evicts dead conns and keeps MinIdle warm conns around
+	if o.HealthCheckInterval > 0 {
+		pool.healthCheckStop = make(chan struct{})
+		go pool.runHealthCheck(o.HealthCheckInterval, pool.healthCheckStop)
+	}
+
+	//parent context cancellation tears the pool down
+	if o.Context != nil {
+		go func() {
+			<-o.Context.Done()
+			pool.Close()
+		}()
 	}
 
 	return pool, nil
@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// newTestPool builds a GRPCPool against a dial target that never actually
+// connects; grpc.DialContext without grpc.WithBlock() returns immediately, so
+// this exercises the pool's bookkeeping without touching the network.
+func newTestPool(t *testing.T, configure func(o *Options)) *GRPCPool {
+	t.Helper()
+
+	o := NewOptions()
+	o.InitTargets = []string{"127.0.0.1:0"}
+	o.LazyInit = false
+	if configure != nil {
+		configure(o)
+	}
+	if o.MaxIdle > o.MaxCap {
+		// NewOptions defaults MaxIdle to the default InitCap (5); callers that
+		// shrink MaxCap below that without also shrinking MaxIdle would
+		// otherwise fail validate()'s MaxIdle<=MaxCap check.
+		o.MaxIdle = o.MaxCap
+	}
+
+	p, err := NewGRPCPool(o, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("NewGRPCPool: %v", err)
+	}
+	return p
+}
+
+func TestGetPutIdleBusyUnderMaxStreams(t *testing.T) {
+	p := newTestPool(t, func(o *Options) {
+		o.InitCap = 1
+		o.MaxCap = 1
+		o.MaxStreams = 2
+	})
+	defer p.Close()
+
+	if got := p.IdleCount(); got != 1 {
+		t.Fatalf("IdleCount() after init = %d, want 1", got)
+	}
+
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get #1: %v", err)
+	}
+	if got := p.IdleCount(); got != 1 {
+		t.Fatalf("IdleCount() after 1/%d streams = %d, want 1 (still under MaxStreams)", 2, got)
+	}
+
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get #2: %v", err)
+	}
+	if c1 != c2 {
+		t.Fatalf("Get() returned distinct conns for a single-conn pool under MaxStreams, want the same multiplexed conn")
+	}
+	if got := p.IdleCount(); got != 0 {
+		t.Fatalf("IdleCount() after saturating MaxStreams = %d, want 0 (conn should have moved to busy)", got)
+	}
+
+	if err := p.Put(c1); err != nil {
+		t.Fatalf("Put #1: %v", err)
+	}
+	if got := p.IdleCount(); got != 1 {
+		t.Fatalf("IdleCount() after releasing one of two streams = %d, want 1 (conn should move back to idle)", got)
+	}
+
+	if err := p.Put(c2); err != nil {
+		t.Fatalf("Put #2: %v", err)
+	}
+	if got := p.IdleCount(); got != 1 {
+		t.Fatalf("IdleCount() after releasing the last stream = %d, want 1", got)
+	}
+}
+
+func TestPutAndReleaseAfterClose(t *testing.T) {
+	p := newTestPool(t, func(o *Options) {
+		o.InitCap = 1
+		o.MaxCap = 1
+	})
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	p.Close()
+
+	if err := p.Put(conn); err != nil {
+		t.Fatalf("Put() after Close must not panic and should just close conn, got err: %v", err)
+	}
+
+	// Release must not panic either, regardless of the error classification.
+	p.Release(conn, nil)
+
+	if _, err := p.Get(); err != errClosed {
+		t.Fatalf("Get() after Close = %v, want errClosed", err)
+	}
+}
+
+func TestCloseRacesWarmUpAndReaper(t *testing.T) {
+	o := NewOptions()
+	o.InitTargets = []string{"127.0.0.1:0"}
+	o.InitCap = 4
+	o.MaxCap = 8
+	o.LazyInit = true
+	o.WarmupConcurrency = 4
+	o.HealthCheckInterval = time.Millisecond
+
+	p, err := NewGRPCPool(o, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("NewGRPCPool: %v", err)
+	}
+
+	// Close immediately, racing the background warmUp dials and the reaper
+	// against pool teardown; regression test for the nil factory/close panic.
+	p.Close()
+
+	// Give any in-flight warmUp/reaper goroutines a chance to land and
+	// observe the closed pool; a panic here would crash the test binary.
+	time.Sleep(50 * time.Millisecond)
+}